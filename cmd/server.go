@@ -3,11 +3,11 @@ package main
 import (
 	"context"
 	"errors"
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"ipfilter/pkg/api"
 	"ipfilter/pkg/config"
 	"ipfilter/pkg/iplist"
+	"ipfilter/pkg/metrics"
 	"log"
 	"log/slog"
 	"net/http"
@@ -48,33 +48,67 @@ func main() {
 
 	settings, err := config.Load("./config.json")
 	if err != nil {
-		logger.Error(fmt.Sprintf("unable to load configuration: %e", err))
+		logger.Error("unable to load configuration", "err", err)
 		return
 	}
 
-	loader := iplist.NewGitHubLoader(
-		settings.ArchiveURL,
-		settings.MaxDownloadBytes,
-		settings.FileSuffixList,
-		logger,
-	)
+	downloadAttempts := settings.DownloadAttempts
+	downloadCooldown := time.Duration(settings.DownloadCooldownMillis) * time.Millisecond
+	downloadTimeout := time.Duration(settings.DownloadTimeoutSeconds) * time.Second
+
+	sources, err := iplist.SourcesFromConfig(settings.Sources, 0, downloadAttempts, downloadCooldown, downloadTimeout)
+	if err != nil {
+		logger.Error("unable to build sources", "err", err)
+		return
+	}
+	allowSources, err := iplist.SourcesFromConfig(settings.AllowSources, 0, downloadAttempts, downloadCooldown, downloadTimeout)
+	if err != nil {
+		logger.Error("unable to build allow sources", "err", err)
+		return
+	}
+	loader := iplist.NewMultiLoader(sources, logger)
+	allowLoader := iplist.NewAllowMultiLoader(allowSources, logger)
 	list := iplist.NewList(1_000_000)
 
+	metrics.ListSize(func() float64 { return float64(list.Len()) })
+	metrics.LastRefreshTimestamp(func() float64 { return float64(list.LastRefresh.Unix()) })
+
+	if settings.OverridesFile != "" {
+		var overrides []iplist.OverrideRule
+		overrides, err = iplist.LoadOverridesFile(settings.OverridesFile)
+		if err != nil {
+			logger.Error("unable to load overrides file", "err", err)
+			return
+		}
+		if err = list.LoadOverrides(overrides); err != nil {
+			logger.Error("unable to apply overrides file", "err", err)
+			return
+		}
+	}
+
 	refreshDuration := time.Duration(settings.RefreshSeconds)
 
 	healthHandle := api.Health(list, refreshDuration)
+	rulesAPI := &api.RulesAPI{OverridesFile: settings.OverridesFile}
+
+	// refreshCtx is canceled as soon as a shutdown signal arrives, so
+	// that an in-flight refresh is abandoned rather than left to run
+	// out its remaining retries.
+	refreshCtx, cancelRefresh := context.WithCancel(context.Background())
+	go func() {
+		<-sigs
+		cancelRefresh()
+	}()
 
-	_, err = loader.Load(list)
+	_, err = loader.Load(refreshCtx, list)
 	if err != nil {
-		if errors.Is(err, iplist.UnchangedVersion) {
-			// This is the first time the List was loaded, so the version
-			// must be different. The problem may rectify itself on a following
-			// refresh, but a warning should be raised.
-			logger.Warn("bad ip list version unchanged", "version", list.Version)
-		} else {
-			logger.Error(fmt.Sprintf("unable to load bad ip list: %e", err))
-			return
-		}
+		logger.Error("unable to load bad ip list", "err", err)
+		return
+	}
+	_, err = allowLoader.Load(refreshCtx, list)
+	if err != nil {
+		logger.Error("unable to load allowlist", "err", err)
+		return
 	}
 
 	go func() {
@@ -82,16 +116,22 @@ func main() {
 	L:
 		for {
 			select {
-			case <-sigs:
+			case <-refreshCtx.Done():
 				break L
 			case <-refreshTimer.C:
 				refreshTimer.Reset(refreshDuration * time.Second)
-				found, err := loader.Load(list)
-				if err != nil && !errors.Is(err, iplist.UnchangedVersion) {
-					logger.Warn(fmt.Sprintf("unable to load bad ip list: %e", err))
+				found, err := loader.Load(refreshCtx, list)
+				if err != nil {
+					logger.Warn("unable to refresh bad ip list", "err", err)
 				} else {
 					logger.Debug("bad ip list refreshed.", "new", found, "stored", list.Len())
 				}
+				allowFound, err := allowLoader.Load(refreshCtx, list)
+				if err != nil {
+					logger.Warn("unable to refresh allowlist", "err", err)
+				} else {
+					logger.Debug("allowlist refreshed.", "new", allowFound)
+				}
 			}
 		}
 		logger.Info("refresher shutting down")
@@ -101,9 +141,17 @@ func main() {
 	r := gin.Default()
 
 	r.Use(api.ListProvider(list))
+	r.Use(api.RequestLogger(logger))
 
 	r.GET("health", healthHandle)
 	r.GET("is-bad-ip", api.IsBadIP)
+	r.GET("metrics", api.Metrics())
+
+	rulesAuth := api.BearerAuth(settings.AdminToken)
+	r.GET("rules", rulesAuth, rulesAPI.List)
+	r.POST("rules", rulesAuth, rulesAPI.Add)
+	r.PUT("rules/*cidr", rulesAuth, rulesAPI.Replace)
+	r.DELETE("rules/*cidr", rulesAuth, rulesAPI.Delete)
 
 	srv := &http.Server{
 		Addr:    ":8080",
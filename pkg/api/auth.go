@@ -0,0 +1,27 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BearerAuth returns gin middleware that rejects any request whose
+// Authorization header does not carry token as a bearer credential. An
+// empty token rejects every request, since there is then no value a
+// caller could present that would be correct.
+func BearerAuth(token string) gin.HandlerFunc {
+	const prefix = "Bearer "
+	return func(c *gin.Context) {
+		auth := c.GetHeader("Authorization")
+		provided := strings.TrimPrefix(auth, prefix)
+		if token == "" || !strings.HasPrefix(auth, prefix) ||
+			subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, msg{Message: "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
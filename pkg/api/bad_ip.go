@@ -1,11 +1,15 @@
 package api
 
 import (
-	"firehol/pkg/badip"
-	"github.com/gin-gonic/gin"
 	"net"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ipfilter/pkg/iplist"
+	"ipfilter/pkg/metrics"
 )
 
 type msg struct {
@@ -13,13 +17,16 @@ type msg struct {
 }
 
 type result struct {
-	IsBadIP bool `json:"is_bad_ip"`
+	IsBadIP     bool `json:"is_bad_ip"`
+	Allowlisted bool `json:"allowlisted,omitempty"`
 }
 
 func IsBadIP(c *gin.Context) {
-	list := c.MustGet("bad_ip_list").(*badip.List)
+	start := time.Now()
+	list := c.MustGet("bad_ip_list").(*iplist.List)
 	address := c.Query("address")
 	if strings.TrimSpace(address) == "" {
+		metrics.RequestsTotal.WithLabelValues("invalid").Inc()
 		c.JSON(http.StatusBadRequest, msg{
 			Message: "missing address parameter value",
 		})
@@ -27,12 +34,30 @@ func IsBadIP(c *gin.Context) {
 	}
 	ip := net.ParseIP(address)
 	if ip == nil {
+		metrics.RequestsTotal.WithLabelValues("invalid").Inc()
 		c.JSON(http.StatusBadRequest, msg{
 			Message: "invalid IP address format",
 		})
 		return
 	}
+	blocked, allowed := list.Classify(ip)
+	defer func() {
+		metrics.LookupDuration.Observe(time.Since(start).Seconds())
+	}()
+	if allowed {
+		metrics.RequestsTotal.WithLabelValues("good").Inc()
+		c.JSON(http.StatusOK, result{
+			IsBadIP:     false,
+			Allowlisted: true,
+		})
+		return
+	}
+	if blocked {
+		metrics.RequestsTotal.WithLabelValues("bad").Inc()
+	} else {
+		metrics.RequestsTotal.WithLabelValues("good").Inc()
+	}
 	c.JSON(http.StatusOK, result{
-		IsBadIP: list.Contains(ip),
+		IsBadIP: blocked,
 	})
 }
@@ -0,0 +1,13 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics returns a gin handler that exposes the collectors registered
+// in pkg/metrics in the Prometheus text exposition format.
+func Metrics() gin.HandlerFunc {
+	handler := promhttp.Handler()
+	return gin.WrapH(handler)
+}
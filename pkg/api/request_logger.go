@@ -0,0 +1,25 @@
+package api
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestLogger returns gin middleware that writes one structured log
+// line per request, after the handler chain has run, so operators can
+// see per-IP query volume alongside the Prometheus counters.
+func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		logger.Info("request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"client_ip", c.ClientIP(),
+			"status", c.Writer.Status(),
+			"duration", time.Since(start),
+		)
+	}
+}
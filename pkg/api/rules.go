@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"ipfilter/pkg/iplist"
+)
+
+// rule is the JSON representation of a single overrides layer entry, for
+// both requests and responses.
+type rule struct {
+	CIDR  string `json:"cidr"`
+	Allow bool   `json:"allow"`
+}
+
+// RulesAPI implements the admin endpoints for listing, adding,
+// replacing, and removing ad-hoc CIDR entries in a List's overrides
+// layer. Every mutation is persisted to OverridesFile immediately, if
+// one is configured, so that a restart does not lose it.
+type RulesAPI struct {
+	OverridesFile string
+
+	// persistLock serializes the read-snapshot-then-write sequence in
+	// persist, so that two concurrent mutations can't race and leave
+	// OverridesFile holding a stale snapshot that drops one of them.
+	persistLock sync.Mutex
+}
+
+// List responds with every rule currently held in the overrides layer.
+func (a *RulesAPI) List(c *gin.Context) {
+	list := c.MustGet("bad_ip_list").(*iplist.List)
+	overrides := list.Overrides()
+	rules := make([]rule, 0, len(overrides))
+	for _, o := range overrides {
+		rules = append(rules, rule{CIDR: o.CIDR, Allow: o.Allow})
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// Add creates or replaces the overrides layer rule for the CIDR given in
+// the JSON request body.
+func (a *RulesAPI) Add(c *gin.Context) {
+	var req rule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, msg{Message: "invalid request body"})
+		return
+	}
+	a.setRule(c, req.CIDR, req.Allow)
+}
+
+// Replace sets the overrides layer rule for the CIDR named in the path
+// to the allow flag given in the JSON request body.
+func (a *RulesAPI) Replace(c *gin.Context) {
+	var req struct {
+		Allow bool `json:"allow"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, msg{Message: "invalid request body"})
+		return
+	}
+	a.setRule(c, pathCIDR(c), req.Allow)
+}
+
+// Delete removes the overrides layer rule for the CIDR named in the
+// path, if one exists.
+func (a *RulesAPI) Delete(c *gin.Context) {
+	list := c.MustGet("bad_ip_list").(*iplist.List)
+	ok, err := list.RemoveOverride(pathCIDR(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, msg{Message: "invalid CIDR"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, msg{Message: "rule not found"})
+		return
+	}
+	if err := a.persist(list); err != nil {
+		c.JSON(http.StatusInternalServerError, msg{Message: "rule removed but not persisted"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (a *RulesAPI) setRule(c *gin.Context, cidr string, allow bool) {
+	list := c.MustGet("bad_ip_list").(*iplist.List)
+	n, err := list.SetOverride(cidr, allow)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, msg{Message: "invalid CIDR"})
+		return
+	}
+	if err := a.persist(list); err != nil {
+		c.JSON(http.StatusInternalServerError, msg{Message: "rule set but not persisted"})
+		return
+	}
+	c.JSON(http.StatusOK, rule{CIDR: n.String(), Allow: allow})
+}
+
+// persist writes the current overrides layer to a.OverridesFile, if one
+// is configured; it is a no-op otherwise. persistLock is held for the
+// full read-then-write sequence so that concurrent requests write their
+// snapshots to disk in a consistent order rather than racing.
+func (a *RulesAPI) persist(list *iplist.List) error {
+	if a.OverridesFile == "" {
+		return nil
+	}
+	a.persistLock.Lock()
+	defer a.persistLock.Unlock()
+	return iplist.SaveOverridesFile(a.OverridesFile, list.Overrides())
+}
+
+// pathCIDR extracts the CIDR from a "/*cidr" wildcard route parameter.
+// A wildcard is needed, rather than a plain ":cidr" segment, because a
+// CIDR's mask suffix ("/24") would otherwise be split across two path
+// segments.
+func pathCIDR(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("cidr"), "/")
+}
@@ -5,10 +5,63 @@ import (
 	"os"
 )
 
+// SourceConfig describes a single bad-address feed to load. type selects
+// which kind of iplist.Source is built from the remaining fields:
+//
+//	"file"           - path holds a local file to read
+//	"http"           - url holds a single plaintext list to fetch
+//	"inline"         - data holds CIDRs embedded directly in config
+//	"github-archive" - url holds a GitHub archive URL, filtered by suffixes
+type SourceConfig struct {
+	Type     string   `json:"type"`
+	URL      string   `json:"url,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Data     string   `json:"data,omitempty"`
+	Suffixes []string `json:"suffixes,omitempty"`
+}
+
 type Settings struct {
-	ArchiveURL     string   `json:"archive_url"`
-	FileSuffixList []string `json:"file_suffix_list"`
-	RefreshSeconds int      `json:"refresh_seconds"`
+	// ArchiveURL and FileSuffixList are deprecated in favor of Sources,
+	// but are still accepted so that existing config.json files keep
+	// working. Load rewrites them into an equivalent "github-archive"
+	// entry in Sources when Sources is not set.
+	ArchiveURL     string   `json:"archive_url,omitempty"`
+	FileSuffixList []string `json:"file_suffix_list,omitempty"`
+
+	Sources []SourceConfig `json:"sources,omitempty"`
+
+	// AllowSources lists feeds of CIDRs that should override a match
+	// against Sources, so that operators can correct false positives
+	// from an upstream feed without editing it directly.
+	AllowSources []SourceConfig `json:"allow_sources,omitempty"`
+
+	RefreshSeconds int `json:"refresh_seconds"`
+
+	// DownloadAttempts is the number of attempts, the first included,
+	// that a "github-archive" source makes at a HEAD or GET that keeps
+	// failing transiently before giving up. Left at zero,
+	// iplist.NewGitHubArchiveSource falls back to its own default.
+	DownloadAttempts int `json:"download_attempts,omitempty"`
+
+	// DownloadCooldownMillis is the delay, in milliseconds, before the
+	// first retry of a failed request. The cooldown doubles after each
+	// further attempt, up to a ceiling owned by the source itself.
+	DownloadCooldownMillis int `json:"download_cooldown_millis,omitempty"`
+
+	// DownloadTimeoutSeconds bounds how long a single HEAD or GET
+	// attempt is allowed to take before it is treated as failed.
+	DownloadTimeoutSeconds int `json:"download_timeout_seconds,omitempty"`
+
+	// OverridesFile is the path where ad-hoc CIDR overrides added
+	// through the admin rules API are persisted, so that a restart
+	// restores them before the first refresh. Left empty, overrides
+	// are kept in memory only and do not survive a restart.
+	OverridesFile string `json:"overrides_file,omitempty"`
+
+	// AdminToken is the bearer token required to call the admin rules
+	// API. Left empty, the admin API rejects every request, since
+	// there is no way to authenticate one.
+	AdminToken string `json:"admin_token,omitempty"`
 }
 
 func Load(path string) (s *Settings, err error) {
@@ -18,5 +71,18 @@ func Load(path string) (s *Settings, err error) {
 		return
 	}
 	err = json.NewDecoder(f).Decode(&s)
+	if err != nil {
+		return
+	}
+
+	if len(s.Sources) == 0 && s.ArchiveURL != "" {
+		s.Sources = []SourceConfig{
+			{
+				Type:     "github-archive",
+				URL:      s.ArchiveURL,
+				Suffixes: s.FileSuffixList,
+			},
+		}
+	}
 	return
 }
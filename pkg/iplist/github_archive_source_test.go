@@ -0,0 +1,98 @@
+package iplist
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, contents := range files {
+		f, err := w.Create(name)
+		assert.Nil(t, err)
+		_, err = f.Write([]byte(contents))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestGitHubArchiveSourceFetchRetriesUntilSuccess(t *testing.T) {
+	archive := newTestArchive(t, map[string]string{"blocklist.netset": "1.2.3.0/24\n"})
+
+	var getFailures int32
+	const failuresBeforeSuccess = 2
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("ETag", "v1")
+			w.WriteHeader(http.StatusOK)
+		case http.MethodGet:
+			if atomic.AddInt32(&getFailures, 1) <= failuresBeforeSuccess {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("ETag", "v1")
+			w.Write(archive)
+		}
+	}))
+	defer server.Close()
+
+	src := NewGitHubArchiveSource(server.URL, 0, failuresBeforeSuccess+1, time.Millisecond, time.Second, []string{".netset"})
+	rc, version, err := src.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "v1", version)
+
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Nil(t, rc.Close())
+	assert.Equal(t, "1.2.3.0/24\n", string(data))
+}
+
+func TestGitHubArchiveSourceFetchHonorsCancellation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("ETag", "v1")
+			w.WriteHeader(http.StatusOK)
+		case http.MethodGet:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	src := NewGitHubArchiveSource(server.URL, 0, 5, time.Millisecond, time.Second, []string{".netset"})
+	_, _, err := src.Fetch(ctx)
+	assert.NotNil(t, err)
+}
+
+func TestGitHubArchiveSourceFetchUnchangedVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", "v1")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	src := NewGitHubArchiveSource(server.URL, 0, 1, time.Millisecond, time.Second, []string{".netset"})
+	src.version = "v1"
+
+	_, version, err := src.Fetch(context.Background())
+	assert.Equal(t, "v1", version)
+	assert.ErrorIs(t, err, UnchangedVersion)
+}
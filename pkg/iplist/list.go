@@ -1,19 +1,11 @@
 package iplist
 
 import (
-	"archive/zip"
-	"bufio"
-	"bytes"
 	"errors"
-	"fmt"
-	"io"
-	"log/slog"
 	"net"
 	"strings"
 	"sync"
 	"time"
-
-	"net/http"
 )
 
 // maxDownloadBytes is a defensive measure to prevent a malicious
@@ -34,13 +26,31 @@ func parseAddress(address string) (*net.IPNet, error) {
 	return n, err
 }
 
-// List contains a set of bad address CIDRs. This data structure is
-// thread safe and allows multiple reads at once. List makes no attempt
-// to shrink the underlying array when values are no longer included in
-// the set.
+// List contains a set of bad address CIDRs, plus an allowlist of CIDRs
+// that override them. This data structure is thread safe and allows
+// multiple reads at once. Internally, each set of addresses is stored in
+// two compressed binary tries, one for IPv4 and one for IPv6, so that a
+// lookup costs at most one step per bit of the address being looked up
+// rather than one step per stored CIDR.
+//
+// On top of the tries built from upstream sources, List also holds an
+// overrides layer: a small set of ad-hoc CIDRs added or removed through
+// the admin API rather than a refresh. The overrides layer is consulted
+// before the upstream tries, so an operator can block or allow an
+// address immediately without waiting for the next refresh, and without
+// the change being lost the next time Add or AddAllow replaces the
+// upstream tries.
 type List struct {
-	lock   sync.RWMutex
-	values []*net.IPNet
+	lock       sync.RWMutex
+	v4, v6     trie
+	allow4     trie
+	allow6     trie
+	count      int
+	allowCount int
+
+	overrides                      map[string]overrideEntry
+	overrideBlock4, overrideBlock6 trie
+	overrideAllow4, overrideAllow6 trie
 
 	// Version indicates the current version of the list data.
 	Version string
@@ -50,244 +60,244 @@ type List struct {
 	LastRefresh time.Time
 }
 
-// NewList creates a new bad ip *List and sets its internal array capacity
-// to the given size value.
+// overrideEntry is a single CIDR held in a List's overrides layer.
+type overrideEntry struct {
+	net   *net.IPNet
+	allow bool
+}
+
+// OverrideRule is a CIDR held in a List's overrides layer, in the form
+// used to list, add, and persist them through the admin API.
+type OverrideRule struct {
+	CIDR  string `json:"cidr"`
+	Allow bool   `json:"allow"`
+}
+
+// NewList creates a new bad ip *List. The size parameter is retained for
+// API compatibility with callers built against the slice-backed List, but
+// no longer has any effect since the trie grows to fit whatever is added.
 func NewList(size int) *List {
-	return &List{
-		values: make([]*net.IPNet, size),
-	}
+	return &List{}
 }
 
-// Len returns the number of entries in the list. If a nil value is
-// encountered, the function will return before traversing the list
-// in its entirety.
-func (l *List) Len() (i int) {
+// Len returns the number of bad address CIDRs currently held by the
+// list. The allowlist and the overrides layer are not counted.
+func (l *List) Len() int {
 	l.lock.RLock()
 	defer l.lock.RUnlock()
-	for ; i < len(l.values); i++ {
-		if l.values[i] == nil {
-			return
-		}
-	}
-	return
+	return l.count
 }
 
-// Contains returns true when the given ip address exists within
-// any one of the CIDRs contained within the list of bad addresses.
-// This check will traverse the entire list of bad addresses until
-// a match is found, or a nil value is encountered. If a nil value
-// is encountered, all remaining indexes should also be nil, so it
-// is favorable to return early. This data structure never shrinks
-// the underlying array, to save compute cycles. A read lock is
-// obtained before traversing the bad addresses.
+// Contains returns true when the given ip address exists within any one
+// of the CIDRs contained within the list of bad addresses, checking the
+// overrides layer's block entries first, then walking the IPv4 or IPv6
+// trie, as appropriate, one bit of the address at a time, returning as
+// soon as a covering CIDR is found. A read lock is obtained before the
+// walk.
 func (l *List) Contains(ip net.IP) bool {
 	if ip == nil {
 		return false
 	}
 	l.lock.RLock()
 	defer l.lock.RUnlock()
-	for _, n := range l.values {
-		if n == nil {
-			return false
-		}
-		if n.Contains(ip) {
-			return true
-		}
+	if v4 := ip.To4(); v4 != nil {
+		return l.overrideBlock4.contains(v4) || l.v4.contains(v4)
+	}
+	v6 := ip.To16()
+	if v6 == nil {
+		return false
 	}
-	return false
+	return l.overrideBlock6.contains(v6) || l.v6.contains(v6)
 }
 
-// Add replaces any current bad addresses in the list with a new
-// set of bad addresses. If the new set of bad addresses is smaller
-// than the existing set, any indexes above the largest index of
-// new set are assigned a nil value so that the old values may be
-// collected by the garbage collector. A write lock is obtained
-// before replacing the current set of addresses.
-func (l *List) Add(addresses []*net.IPNet) {
-	l.lock.Lock()
-	defer l.lock.Unlock()
-	var i int
-	for ; i < len(addresses); i++ {
-		l.values[i] = addresses[i]
+// IsAllowed returns true when the given ip address exists within any one
+// of the CIDRs on the allowlist, checking the overrides layer's allow
+// entries first. An allowlist match overrides a match against the bad
+// address list; see Classify.
+func (l *List) IsAllowed(ip net.IP) bool {
+	if ip == nil {
+		return false
 	}
-	for ; i < len(l.values); i++ {
-		l.values[i] = nil
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if v4 := ip.To4(); v4 != nil {
+		return l.overrideAllow4.contains(v4) || l.allow4.contains(v4)
+	}
+	v6 := ip.To16()
+	if v6 == nil {
+		return false
 	}
+	return l.overrideAllow6.contains(v6) || l.allow6.contains(v6)
 }
 
-// GitHubLoader loads bad IP address lists from the firehol/blocklist-ipsets
-// GitHub repository, specifically. The entire master branch of the repo is
-// downloaded as an archive file and processed into a List. Only files in
-// the archive whose name suffix matches the values in fileSuffixList will
-// be processed.
-type GitHubLoader struct {
-	archiveURL     string
-	fileSuffixList []string
-	logger         *slog.Logger
+// Classify reports both whether ip matches the bad address list and
+// whether it matches the allowlist. allowed takes precedence over
+// blocked: a caller deciding whether to reject an address should treat
+// an allowlisted address as good regardless of the value of blocked.
+//
+// An ip covered by the overrides layer is decided entirely by the
+// overrides layer, ignoring whatever the upstream tries say: a block
+// override exists to correct a mistake further upstream, such as an
+// address that should never have ended up on an allowlist, so it must
+// not be neutralized by that same upstream allow entry.
+func (l *List) Classify(ip net.IP) (blocked, allowed bool) {
+	if ip == nil {
+		return false, false
+	}
+	if blocked, allowed = l.overrideClassify(ip); blocked || allowed {
+		return blocked, allowed
+	}
+	return l.Contains(ip), l.IsAllowed(ip)
 }
 
-// NewGitHubLoader returns a newly instantiated GitHubLoader with the provided
-// configuration parameters.
-func NewGitHubLoader(archiveURL string, fileSuffixList []string, logger *slog.Logger) *GitHubLoader {
-	return &GitHubLoader{
-		archiveURL:     archiveURL,
-		fileSuffixList: fileSuffixList,
-		logger:         logger,
+// overrideClassify reports whether ip matches the overrides layer's
+// block entries, its allow entries, or neither, without looking at the
+// tries built from upstream sources at all.
+func (l *List) overrideClassify(ip net.IP) (blocked, allowed bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if v4 := ip.To4(); v4 != nil {
+		return l.overrideBlock4.contains(v4), l.overrideAllow4.contains(v4)
+	}
+	v6 := ip.To16()
+	if v6 == nil {
+		return false, false
 	}
+	return l.overrideBlock6.contains(v6), l.overrideAllow6.contains(v6)
 }
 
-// Load will attempt to refresh the entries in the List. First a HEAD request
-// will be made to the repository. If the returned ETag is different from the
-// last seen value, or if this is the first time the List is being refreshed,
-// Load will make a GET request to the repository to download a zip archive
-// of the entire master branch. All addresses contained within the archive files
-// are parsed into valid net.IPNet values before being added to the List.
-//
-// The found value indicates the number of valid values that were identified in
-// the archive. If the found value is greater than the length of the List, then
-// the capacity of the List was not sufficient to hold all found values.
-func (l *GitHubLoader) Load(list *List) (found int, err error) {
-	// Record an attempt to refresh the list.
-	list.LastRefresh = time.Now()
+// Add replaces any current bad addresses in the list with a new set of
+// bad addresses, rebuilding the IPv4 and IPv6 tries from scratch. A write
+// lock is obtained before the tries are replaced.
+func (l *List) Add(addresses []*net.IPNet) {
+	v4, v6, count := buildTries(addresses)
 
-	// The version of the resource may not have changed since the last
-	// download, so before requesting the resource data, the header is
-	// requested to compare the version.
-	resp, err := http.Head(l.archiveURL)
-	if err != nil {
-		return
-	}
-	_ = resp.Body.Close()
-	tETag := resp.Header.Get("ETag")
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.v4 = v4
+	l.v6 = v6
+	l.count = count
+}
 
-	if tETag == list.Version {
-		err = UnchangedVersion
-		return
-	}
+// AddAllow replaces the current allowlist with a new set of allowed
+// addresses, rebuilding the IPv4 and IPv6 allow tries from scratch. A
+// write lock is obtained before the tries are replaced.
+func (l *List) AddAllow(addresses []*net.IPNet) {
+	v4, v6, count := buildTries(addresses)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.allow4 = v4
+	l.allow6 = v6
+	l.allowCount = count
+}
 
-	// The version of the resource is different, so the data needs to be
-	// refreshed with the new version.
-	resp, err = http.Get(l.archiveURL)
+// SetOverride adds or replaces the overrides layer rule for cidr,
+// marking it as a block entry (allow false) or an allow entry (allow
+// true). The block and allow tries for the overrides layer are rebuilt
+// immediately under a write lock, so the change is visible to the very
+// next Contains or IsAllowed call.
+func (l *List) SetOverride(cidr string, allow bool) (*net.IPNet, error) {
+	n, err := parseAddress(cidr)
 	if err != nil {
-		return
+		return nil, err
 	}
-	defer resp.Body.Close()
+	key := n.String()
 
-	// Allocate an initial amount of space to hold the downloaded
-	// data. This will mitigate growth operations of the backing
-	// array.
-	buf := bytes.NewBuffer(make([]byte, 0, maxDownloadBytes))
-
-	// Since the response body has a transfer encoding of "chunked"
-	// we will not know the size of the payload before reading to
-	// EOF. Therefore, io.Copy is not a safe choice to use here, as
-	// a malicious downstream server could send an unbounded payload.
-	// Instead, calls to Read will be made iteratively, 1024 bytes at
-	// time, up to maxDownloadBytes.
-	ibuf := make([]byte, 1024)
-	for i := 0; i < maxDownloadBytes; {
-		var bread int
-		bread, err = resp.Body.Read(ibuf)
-		if err == io.EOF && bread == 0 {
-			break
-		}
-		if err != nil {
-			return
-		}
-		buf.Write(ibuf[:bread])
-		i += bread
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.overrides == nil {
+		l.overrides = make(map[string]overrideEntry)
 	}
-	copied := int64(buf.Len())
+	l.overrides[key] = overrideEntry{net: n, allow: allow}
+	l.rebuildOverrides()
+	return n, nil
+}
 
-	// An error resulting from closing the body may be indicative
-	// of an issue with the response payload.
-	err = resp.Body.Close()
+// RemoveOverride deletes the overrides layer rule for cidr, if one
+// exists, reporting whether a rule was actually removed.
+func (l *List) RemoveOverride(cidr string) (bool, error) {
+	n, err := parseAddress(cidr)
 	if err != nil {
-		return
+		return false, err
 	}
-	reader := bytes.NewReader(buf.Bytes())
-	zipReader, err := zip.NewReader(reader, copied)
-	if err != nil {
-		return
+	key := n.String()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, ok := l.overrides[key]; !ok {
+		return false, nil
 	}
+	delete(l.overrides, key)
+	l.rebuildOverrides()
+	return true, nil
+}
 
-	// Here a trade-off is made by using additional memory to preserve the
-	// integrity of the current bad ip list. Making this trade-off also reduces
-	// the amount of time that a write lock will be held on the list.
-	// An alternative would be to write directly to the list.values array,
-	// however, an error during parsing could leave the list in a broken state.
-	results := make([]chan *net.IPNet, 0, len(zipReader.File))
-	for _, file := range zipReader.File {
-		if file.FileHeader.FileInfo().IsDir() {
-			continue
-		}
+// Overrides returns a snapshot of the rules currently held in the
+// overrides layer, in no particular order.
+func (l *List) Overrides() []OverrideRule {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	rules := make([]OverrideRule, 0, len(l.overrides))
+	for cidr, e := range l.overrides {
+		rules = append(rules, OverrideRule{CIDR: cidr, Allow: e.allow})
+	}
+	return rules
+}
 
-		var processFile bool
-		for i := 0; i < len(l.fileSuffixList); i++ {
-			if strings.HasSuffix(file.Name, l.fileSuffixList[i]) {
-				processFile = true
-			}
+// LoadOverrides replaces the entire overrides layer with rules, without
+// touching the tries built from upstream sources. It is meant for
+// restoring a previously persisted overrides file at startup, before the
+// first call to Add or AddAllow.
+func (l *List) LoadOverrides(rules []OverrideRule) error {
+	overrides := make(map[string]overrideEntry, len(rules))
+	for _, r := range rules {
+		n, err := parseAddress(r.CIDR)
+		if err != nil {
+			return err
 		}
+		overrides[n.String()] = overrideEntry{net: n, allow: r.Allow}
+	}
 
-		if !processFile {
-			continue
-		}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.overrides = overrides
+	l.rebuildOverrides()
+	return nil
+}
 
-		var f io.ReadCloser
-		f, err = file.Open()
-		if err != nil {
-			l.logger.Warn(fmt.Sprintf("open file: %e", err), "file", file.Name)
-			continue
+// rebuildOverrides rebuilds the overrides layer's block and allow tries
+// from the current overrides map. Callers must hold l.lock for writing.
+func (l *List) rebuildOverrides() {
+	var blocks, allows []*net.IPNet
+	for _, e := range l.overrides {
+		if e.allow {
+			allows = append(allows, e.net)
+		} else {
+			blocks = append(blocks, e.net)
 		}
-		ch := make(chan *net.IPNet, 100)
-		go func() {
-			defer close(ch)
-			defer f.Close()
-
-			scn := bufio.NewScanner(f)
-			for scn.Scan() {
-				line := scn.Text()
-				if strings.HasPrefix(line, "#") {
-					continue
-				}
-				var addr *net.IPNet
-				addr, err = parseAddress(strings.TrimSpace(line))
-				if err != nil {
-					l.logger.Warn(fmt.Sprintf("parse address: %e", err), "address", line)
-					continue
-				}
-				ch <- addr
-			}
-		}()
-		results = append(results, ch)
 	}
-	collection := make([]*net.IPNet, 0, cap(list.values))
-
-	for {
-		var alive bool
+	l.overrideBlock4, l.overrideBlock6, _ = buildTries(blocks)
+	l.overrideAllow4, l.overrideAllow6, _ = buildTries(allows)
+}
 
-		// iterate over channels and pull out the next available item, but
-		// don't wait for an item to become available.
-		for i := 0; i < len(results); i++ {
-			select {
-			case v, ok := <-results[i]:
-				if ok {
-					collection = append(collection, v)
-					alive = true
-				}
-			default:
-				// the channel is still open, but there weren't any items
-				// waiting to be processed.
-				alive = true
-			}
+// buildTries parses a set of networks into separate IPv4 and IPv6 tries,
+// returning the total number of networks stored.
+func buildTries(addresses []*net.IPNet) (v4, v6 trie, count int) {
+	for _, n := range addresses {
+		if n == nil {
+			continue
 		}
-		if !alive {
-			// all channels have been closed at this point
-			break
+		ones, bits := n.Mask.Size()
+		switch bits {
+		case 32:
+			v4.insert(n.IP.To4(), ones)
+		case 128:
+			v6.insert(n.IP.To16(), ones)
+		default:
+			continue
 		}
+		count++
 	}
-	found = len(collection)
-	list.Add(collection)
-	list.Version = tETag
 	return
 }
@@ -0,0 +1,78 @@
+package iplist
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+// randomCIDRs generates n pseudo-random IPv4 CIDRs of varying prefix
+// length, the way a firehol feed mixes /32 hosts with wider netblocks.
+// The CIDRs are not de-duplicated, so the same one may appear more than
+// once.
+func randomCIDRs(n int) []*net.IPNet {
+	r := rand.New(rand.NewSource(1))
+	out := make([]*net.IPNet, n)
+	for i := 0; i < n; i++ {
+		ip := net.IPv4(byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256))).To4()
+		ones := 16 + r.Intn(17) // /16 .. /32
+		mask := net.CIDRMask(ones, 32)
+		out[i] = &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+	}
+	return out
+}
+
+// naiveList reproduces the previous slice-scan implementation of Contains,
+// kept here only to benchmark against the trie.
+type naiveList struct {
+	values []*net.IPNet
+}
+
+func (n *naiveList) Contains(ip net.IP) bool {
+	for _, v := range n.values {
+		if v.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func benchmarkTrie(b *testing.B, n int) {
+	cidrs := randomCIDRs(n)
+	l := NewList(n)
+	l.Add(cidrs)
+	ip := net.IPv4(8, 8, 8, 8)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Contains(ip)
+	}
+}
+
+func benchmarkSlice(b *testing.B, n int) {
+	cidrs := randomCIDRs(n)
+	nl := &naiveList{values: cidrs}
+	ip := net.IPv4(8, 8, 8, 8)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		nl.Contains(ip)
+	}
+}
+
+func BenchmarkTrieContains(b *testing.B) {
+	for _, n := range []int{10_000, 100_000, 1_000_000} {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			benchmarkTrie(b, n)
+		})
+	}
+}
+
+func BenchmarkSliceContains(b *testing.B) {
+	for _, n := range []int{10_000, 100_000, 1_000_000} {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			benchmarkSlice(b, n)
+		})
+	}
+}
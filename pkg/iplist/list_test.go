@@ -55,3 +55,87 @@ func TestParseAddress(t *testing.T) {
 		})
 	}
 }
+
+func TestListClassifyAllowOverridesBlock(t *testing.T) {
+	l := NewList(0)
+
+	_, blocked, _ := net.ParseCIDR("10.0.0.0/8")
+	l.Add([]*net.IPNet{blocked})
+
+	_, allowed, _ := net.ParseCIDR("10.1.0.0/16")
+	l.AddAllow([]*net.IPNet{allowed})
+
+	isBlocked, isAllowed := l.Classify(net.ParseIP("10.1.2.3"))
+	assert.True(t, isBlocked)
+	assert.True(t, isAllowed)
+
+	isBlocked, isAllowed = l.Classify(net.ParseIP("10.2.0.1"))
+	assert.True(t, isBlocked)
+	assert.False(t, isAllowed)
+
+	isBlocked, isAllowed = l.Classify(net.ParseIP("8.8.8.8"))
+	assert.False(t, isBlocked)
+	assert.False(t, isAllowed)
+}
+
+func TestListOverridesConsultedBeforeUpstream(t *testing.T) {
+	l := NewList(0)
+
+	_, allowed, _ := net.ParseCIDR("8.8.8.0/24")
+	l.AddAllow([]*net.IPNet{allowed})
+
+	n, err := l.SetOverride("8.8.8.8/32", false)
+	assert.Nil(t, err)
+	assert.Equal(t, "8.8.8.8/32", n.String())
+
+	// The override blocks 8.8.8.8 even though it is also covered by the
+	// allowlist built from upstream sources: Classify decides addresses
+	// covered by the overrides layer without consulting upstream at
+	// all, so a block override can correct a bad upstream allow entry.
+	isBlocked, isAllowed := l.Classify(net.ParseIP("8.8.8.8"))
+	assert.True(t, isBlocked)
+	assert.False(t, isAllowed)
+
+	// Removing the override stops blocking it.
+	removed, err := l.RemoveOverride("8.8.8.8/32")
+	assert.Nil(t, err)
+	assert.True(t, removed)
+	isBlocked, _ = l.Classify(net.ParseIP("8.8.8.8"))
+	assert.False(t, isBlocked)
+
+	// A second removal reports that there was nothing left to remove.
+	removed, err = l.RemoveOverride("8.8.8.8/32")
+	assert.Nil(t, err)
+	assert.False(t, removed)
+}
+
+func TestListOverridesSurviveUpstreamRefresh(t *testing.T) {
+	l := NewList(0)
+
+	_, err := l.SetOverride("203.0.113.0/24", false)
+	assert.Nil(t, err)
+
+	// Add replaces the upstream tries wholesale, but must not disturb
+	// the overrides layer alongside them.
+	_, blocked, _ := net.ParseCIDR("198.51.100.0/24")
+	l.Add([]*net.IPNet{blocked})
+
+	assert.True(t, l.Contains(net.ParseIP("203.0.113.1")))
+	assert.True(t, l.Contains(net.ParseIP("198.51.100.1")))
+}
+
+func TestListLoadOverrides(t *testing.T) {
+	l := NewList(0)
+
+	err := l.LoadOverrides([]OverrideRule{
+		{CIDR: "203.0.113.0/24", Allow: false},
+		{CIDR: "192.0.2.0/24", Allow: true},
+	})
+	assert.Nil(t, err)
+
+	assert.True(t, l.Contains(net.ParseIP("203.0.113.1")))
+	assert.True(t, l.IsAllowed(net.ParseIP("192.0.2.1")))
+
+	rules := l.Overrides()
+	assert.Len(t, rules, 2)
+}
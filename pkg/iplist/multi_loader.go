@@ -0,0 +1,131 @@
+package iplist
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"ipfilter/pkg/metrics"
+)
+
+// MultiLoader refreshes a List from any number of Source values, fanning
+// the fetches out concurrently and merging the CIDRs they each parse into
+// a single call to List.Add (or List.AddAllow, for a MultiLoader built
+// with NewAllowMultiLoader). A Source whose Fetch reports
+// UnchangedVersion, or which fails outright, contributes whatever it
+// last successfully parsed rather than dropping out of the merged list
+// entirely.
+type MultiLoader struct {
+	sources []Source
+	logger  *slog.Logger
+	allow   bool
+
+	mu    sync.Mutex
+	cache [][]*net.IPNet
+}
+
+// NewMultiLoader returns a MultiLoader that refreshes a List's bad
+// address set from the given sources.
+func NewMultiLoader(sources []Source, logger *slog.Logger) *MultiLoader {
+	return newMultiLoader(sources, logger, false)
+}
+
+// NewAllowMultiLoader returns a MultiLoader that refreshes a List's
+// allowlist from the given sources.
+func NewAllowMultiLoader(sources []Source, logger *slog.Logger) *MultiLoader {
+	return newMultiLoader(sources, logger, true)
+}
+
+func newMultiLoader(sources []Source, logger *slog.Logger, allow bool) *MultiLoader {
+	return &MultiLoader{
+		sources: sources,
+		logger:  logger,
+		allow:   allow,
+		cache:   make([][]*net.IPNet, len(sources)),
+	}
+}
+
+// Load fetches every source concurrently, parses each one's addresses,
+// and merges the results into a single call to list.Add or
+// list.AddAllow. The found value indicates the number of addresses that
+// ended up in the merged list.
+func (m *MultiLoader) Load(ctx context.Context, list *List) (found int, err error) {
+	list.LastRefresh = time.Now()
+
+	type outcome struct {
+		addresses []*net.IPNet
+		err       error
+	}
+	results := make([]outcome, len(m.sources))
+
+	var wg sync.WaitGroup
+	for i, src := range m.sources {
+		wg.Add(1)
+		go func(i int, src Source) {
+			defer wg.Done()
+			addresses, ferr := m.fetchOne(ctx, src)
+			results[i] = outcome{addresses: addresses, err: ferr}
+		}(i, src)
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var merged []*net.IPNet
+	for i, r := range results {
+		switch {
+		case r.err == nil:
+			m.cache[i] = r.addresses
+			m.logger.Debug("source refreshed", "source", i, "count", len(r.addresses))
+		case errors.Is(r.err, UnchangedVersion):
+			m.logger.Debug("source version unchanged", "source", i, "count", len(m.cache[i]))
+		default:
+			metrics.RefreshFailuresTotal.Inc()
+			m.logger.Warn("load source", "err", r.err, "source", i, "stored", len(m.cache[i]))
+		}
+		merged = append(merged, m.cache[i]...)
+	}
+
+	found = len(merged)
+	if m.allow {
+		list.AddAllow(merged)
+	} else {
+		list.Add(merged)
+	}
+	return
+}
+
+// fetchOne fetches and parses a single source into addresses.
+func (m *MultiLoader) fetchOne(ctx context.Context, src Source) ([]*net.IPNet, error) {
+	rc, _, err := src.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var addresses []*net.IPNet
+	scn := bufio.NewScanner(rc)
+	for scn.Scan() {
+		line := strings.TrimSpace(scn.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		addr, perr := parseAddress(line)
+		if perr != nil {
+			m.logger.Warn("parse address", "err", perr, "address", line)
+			continue
+		}
+		addresses = append(addresses, addr)
+	}
+	if err := scn.Err(); err != nil && err != io.EOF {
+		return addresses, err
+	}
+	return addresses, nil
+}
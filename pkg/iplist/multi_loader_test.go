@@ -0,0 +1,66 @@
+package iplist
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestMultiLoaderLoadMergesSources(t *testing.T) {
+	logger := discardLogger()
+	sources := []Source{
+		NewInlineSource("10.0.0.0/8\n"),
+		NewInlineSource("192.168.0.0/16\n"),
+	}
+	loader := NewMultiLoader(sources, logger)
+	list := NewList(0)
+
+	found, err := loader.Load(context.Background(), list)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, found)
+	assert.True(t, list.Contains(net.ParseIP("10.1.2.3")))
+	assert.True(t, list.Contains(net.ParseIP("192.168.1.1")))
+	assert.False(t, list.Contains(net.ParseIP("8.8.8.8")))
+}
+
+// unchangedAfterFirstSource serves data on its first Fetch and reports
+// UnchangedVersion on every Fetch after that.
+type unchangedAfterFirstSource struct {
+	data    string
+	fetched bool
+}
+
+func (s *unchangedAfterFirstSource) Fetch(_ context.Context) (io.ReadCloser, string, error) {
+	if s.fetched {
+		return nil, "v1", UnchangedVersion
+	}
+	s.fetched = true
+	return io.NopCloser(strings.NewReader(s.data)), "v1", nil
+}
+
+func TestMultiLoaderLoadKeepsUnchangedSource(t *testing.T) {
+	logger := discardLogger()
+	sources := []Source{&unchangedAfterFirstSource{data: "10.0.0.0/8\n"}}
+	loader := NewMultiLoader(sources, logger)
+	list := NewList(0)
+
+	found, err := loader.Load(context.Background(), list)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, found)
+
+	// The second refresh gets UnchangedVersion from the source, so the
+	// previously parsed address must be kept around.
+	found, err = loader.Load(context.Background(), list)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, found)
+	assert.True(t, list.Contains(net.ParseIP("10.1.2.3")))
+}
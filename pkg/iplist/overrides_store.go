@@ -0,0 +1,36 @@
+package iplist
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// LoadOverridesFile reads the set of OverrideRule values previously
+// written by SaveOverridesFile from path. A missing file is not treated
+// as an error; it simply yields no rules, since that is what "nothing
+// has been persisted yet" looks like on disk.
+func LoadOverridesFile(path string) ([]OverrideRule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var rules []OverrideRule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// SaveOverridesFile persists rules to path as JSON, replacing whatever
+// was there before, so that a later call to LoadOverridesFile restores
+// the same set.
+func SaveOverridesFile(path string, rules []OverrideRule) error {
+	b, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
@@ -0,0 +1,36 @@
+package iplist
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverridesFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "overrides.json")
+
+	rules := []OverrideRule{
+		{CIDR: "10.0.0.0/8", Allow: false},
+		{CIDR: "10.1.0.0/16", Allow: true},
+	}
+	assert.Nil(t, SaveOverridesFile(path, rules))
+
+	loaded, err := LoadOverridesFile(path)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, rules, loaded)
+}
+
+func TestLoadOverridesFileMissing(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "does-not-exist.json")
+
+	rules, err := LoadOverridesFile(path)
+	assert.Nil(t, err)
+	assert.Nil(t, rules)
+
+	_, statErr := os.Stat(path)
+	assert.True(t, os.IsNotExist(statErr))
+}
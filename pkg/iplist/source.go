@@ -0,0 +1,378 @@
+package iplist
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"ipfilter/pkg/config"
+	"ipfilter/pkg/metrics"
+)
+
+// Source retrieves the raw contents of a bad-address feed. The returned
+// reader yields newline-delimited CIDRs or bare addresses, in the same
+// format firehol's lists use, and must be closed by the caller. version
+// is an opaque token that changes whenever the underlying content does;
+// a Source may return UnchangedVersion alongside a nil reader when it
+// knows its content is identical to the last time it was fetched, so
+// that callers can skip re-parsing it.
+type Source interface {
+	Fetch(ctx context.Context) (r io.ReadCloser, version string, err error)
+}
+
+// FileSource reads a bad-address feed from a local file. Its version is
+// derived from the file's modification time, so touching the file is
+// enough to force a reload.
+type FileSource struct {
+	path string
+}
+
+// NewFileSource returns a FileSource reading from path.
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+func (s *FileSource) Fetch(_ context.Context) (io.ReadCloser, string, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, "", err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, "", err
+	}
+	return f, info.ModTime().UTC().Format(time.RFC3339Nano), nil
+}
+
+// HTTPSource reads a plaintext bad-address feed from a single URL. Its
+// version is taken from the ETag header, falling back to Last-Modified
+// when no ETag is present.
+type HTTPSource struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSource returns an HTTPSource reading from url using
+// http.DefaultClient.
+func NewHTTPSource(url string) *HTTPSource {
+	return &HTTPSource{url: url, client: http.DefaultClient}
+}
+
+func (s *HTTPSource) Fetch(ctx context.Context) (io.ReadCloser, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, "", fmt.Errorf("unexpected status %d fetching %s", resp.StatusCode, s.url)
+	}
+	version := resp.Header.Get("ETag")
+	if version == "" {
+		version = resp.Header.Get("Last-Modified")
+	}
+	return resp.Body, version, nil
+}
+
+// InlineSource serves a fixed set of addresses embedded directly in
+// configuration, rather than fetched from anywhere. Its version is a
+// hash of the configured data, so it only ever changes if the
+// configuration itself changes.
+type InlineSource struct {
+	data string
+}
+
+// NewInlineSource returns an InlineSource serving the given newline
+// delimited data.
+func NewInlineSource(data string) *InlineSource {
+	return &InlineSource{data: data}
+}
+
+func (s *InlineSource) Fetch(_ context.Context) (io.ReadCloser, string, error) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s.data))
+	version := fmt.Sprintf("%x", h.Sum64())
+	return io.NopCloser(strings.NewReader(s.data)), version, nil
+}
+
+// Defaults applied by GitHubArchiveSource when its configurable retry
+// knobs are left at their zero value.
+const (
+	defaultDownloadAttempts = 3
+	defaultDownloadCooldown = 500 * time.Millisecond
+	defaultDownloadTimeout  = 30 * time.Second
+	maxDownloadCooldown     = 30 * time.Second
+)
+
+// GitHubArchiveSource reads bad-address feeds out of a zip archive of a
+// GitHub repository, the way firehol/blocklist-ipsets publishes its
+// lists. Only files whose name suffix matches one of fileSuffixList are
+// surfaced; everything else in the archive is ignored. A GitHubArchiveSource
+// remembers the ETag of the archive it last downloaded, so that a Fetch
+// which finds the archive unchanged can report UnchangedVersion without
+// downloading it again.
+//
+// A HEAD or GET made against archiveURL that fails transiently is
+// retried, with an exponentially increasing cooldown between attempts,
+// for at most attempts attempts in all; any other failure ends the
+// Fetch at once. A timeout is applied to each individual attempt, and the whole
+// operation is abandoned immediately if ctx is canceled, so that a
+// hung download can be aborted by the caller without waiting out the
+// remaining retries.
+type GitHubArchiveSource struct {
+	archiveURL     string
+	maxBytes       int
+	fileSuffixList []string
+
+	attempts int
+	cooldown time.Duration
+	timeout  time.Duration
+	client   *http.Client
+
+	version string
+}
+
+// NewGitHubArchiveSource returns a GitHubArchiveSource with the provided
+// configuration parameters. attempts, cooldown, and timeout may be left
+// at their zero value to fall back to reasonable defaults.
+func NewGitHubArchiveSource(archiveURL string, maxBytes, attempts int, cooldown, timeout time.Duration, fileSuffixList []string) *GitHubArchiveSource {
+	return &GitHubArchiveSource{
+		archiveURL:     archiveURL,
+		maxBytes:       maxBytes,
+		fileSuffixList: fileSuffixList,
+		attempts:       attempts,
+		cooldown:       cooldown,
+		timeout:        timeout,
+		client:         http.DefaultClient,
+	}
+}
+
+func (s *GitHubArchiveSource) Fetch(ctx context.Context) (io.ReadCloser, string, error) {
+	// The version of the resource may not have changed since the last
+	// download, so before requesting the resource data, the header is
+	// requested to compare the version. UnchangedVersion is returned
+	// as soon as this is known, without retrying the HEAD request
+	// further or making the GET request at all.
+	etag, _, err := s.fetchWithRetry(ctx, http.MethodHead, false)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag == s.version {
+		return nil, etag, UnchangedVersion
+	}
+
+	etag, body, err := s.fetchWithRetry(ctx, http.MethodGet, true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	zipReader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, "", err
+	}
+
+	var readers []io.Reader
+	var closers []io.Closer
+	for _, file := range zipReader.File {
+		if file.FileHeader.FileInfo().IsDir() {
+			continue
+		}
+
+		var matched bool
+		for _, suffix := range s.fileSuffixList {
+			if strings.HasSuffix(file.Name, suffix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		f, err := file.Open()
+		if err != nil {
+			return nil, "", err
+		}
+		readers = append(readers, f)
+		closers = append(closers, f)
+	}
+
+	s.version = etag
+	return &multiReadCloser{r: io.MultiReader(readers...), closers: closers}, etag, nil
+}
+
+// fetchWithRetry issues method against archiveURL, retrying transient
+// failures with an exponentially increasing cooldown between attempts.
+// When readBody is true the response body is read, bounded by maxBytes,
+// and returned; otherwise only the ETag header is returned.
+func (s *GitHubArchiveSource) fetchWithRetry(ctx context.Context, method string, readBody bool) (etag string, body []byte, err error) {
+	attempts := s.attempts
+	if attempts <= 0 {
+		attempts = defaultDownloadAttempts
+	}
+	cooldown := s.cooldown
+	if cooldown <= 0 {
+		cooldown = defaultDownloadCooldown
+	}
+	timeout := s.timeout
+	if timeout <= 0 {
+		timeout = defaultDownloadTimeout
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return "", nil, ctx.Err()
+			case <-time.After(cooldown):
+			}
+			cooldown *= 2
+			if cooldown > maxDownloadCooldown {
+				cooldown = maxDownloadCooldown
+			}
+		}
+
+		var retry bool
+		etag, body, retry, err = s.attempt(ctx, method, timeout, readBody)
+		if err == nil {
+			return etag, body, nil
+		}
+		lastErr = err
+		if !retry {
+			return "", nil, err
+		}
+	}
+	return "", nil, fmt.Errorf("fetching %s after %d attempts: %w", s.archiveURL, attempts, lastErr)
+}
+
+// attempt performs a single HEAD or GET request, bounded by timeout.
+// retry reports whether the failure looks transient and is worth
+// retrying: a network error, a 5xx response, or an unexpected EOF while
+// reading the body. Context cancellation is never retryable.
+func (s *GitHubArchiveSource) attempt(ctx context.Context, method string, timeout time.Duration, readBody bool) (etag string, body []byte, retry bool, err error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(attemptCtx, method, s.archiveURL, nil)
+	if err != nil {
+		return "", nil, false, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", nil, isTransient(err), err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return "", nil, true, fmt.Errorf("unexpected status %d fetching %s", resp.StatusCode, s.archiveURL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, false, fmt.Errorf("unexpected status %d fetching %s", resp.StatusCode, s.archiveURL)
+	}
+
+	etag = resp.Header.Get("ETag")
+	if !readBody {
+		return etag, nil, false, nil
+	}
+
+	maxBytes := s.maxBytes
+	if maxBytes <= 0 {
+		maxBytes = maxDownloadBytes
+	}
+
+	// Allocate an initial amount of space to hold the downloaded
+	// data. This will mitigate growth operations of the backing
+	// array.
+	buf := bytes.NewBuffer(make([]byte, 0, maxBytes))
+
+	// Since the response body has a transfer encoding of "chunked"
+	// we will not know the size of the payload before reading to
+	// EOF. Therefore, io.Copy is not a safe choice to use here, as
+	// a malicious downstream server could send an unbounded payload.
+	// Instead, calls to Read will be made iteratively, 1024 bytes at
+	// a time, up to maxBytes.
+	ibuf := make([]byte, 1024)
+	for i := 0; i < maxBytes; {
+		var bread int
+		bread, err = resp.Body.Read(ibuf)
+		buf.Write(ibuf[:bread])
+		i += bread
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			return "", nil, isTransient(err), err
+		}
+	}
+	metrics.DownloadBytesTotal.Add(float64(buf.Len()))
+	return etag, buf.Bytes(), false, nil
+}
+
+// isTransient reports whether err is worth retrying. Context
+// cancellation and deadline expiry are deliberately excluded, so that a
+// caller aborting a refresh does not wait out the remaining attempts.
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// multiReadCloser concatenates the contents of a set of readers, the way
+// io.MultiReader does, while also closing every one of them on Close.
+type multiReadCloser struct {
+	r       io.Reader
+	closers []io.Closer
+}
+
+func (m *multiReadCloser) Read(p []byte) (int, error) {
+	return m.r.Read(p)
+}
+
+func (m *multiReadCloser) Close() error {
+	var err error
+	for _, c := range m.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// SourcesFromConfig builds the Source values described by a list of
+// config.SourceConfig entries, as found in config.Settings.Sources and
+// config.Settings.AllowSources. attempts, cooldown, and timeout are
+// applied to any "github-archive" sources in cfgs.
+func SourcesFromConfig(cfgs []config.SourceConfig, maxBytes, attempts int, cooldown, timeout time.Duration) ([]Source, error) {
+	sources := make([]Source, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		switch cfg.Type {
+		case "file":
+			sources = append(sources, NewFileSource(cfg.Path))
+		case "http":
+			sources = append(sources, NewHTTPSource(cfg.URL))
+		case "inline":
+			sources = append(sources, NewInlineSource(cfg.Data))
+		case "github-archive":
+			sources = append(sources, NewGitHubArchiveSource(cfg.URL, maxBytes, attempts, cooldown, timeout, cfg.Suffixes))
+		default:
+			return nil, errors.New("unknown source type: " + cfg.Type)
+		}
+	}
+	return sources, nil
+}
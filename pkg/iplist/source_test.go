@@ -0,0 +1,44 @@
+package iplist
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSourceFetch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "blocklist.netset")
+	assert.Nil(t, os.WriteFile(path, []byte("10.0.0.0/8\n"), 0o644))
+
+	src := NewFileSource(path)
+	rc, version, err := src.Fetch(context.Background())
+	assert.Nil(t, err)
+	assert.NotEmpty(t, version)
+
+	data, err := io.ReadAll(rc)
+	assert.Nil(t, err)
+	assert.Nil(t, rc.Close())
+	assert.Equal(t, "10.0.0.0/8\n", string(data))
+}
+
+func TestInlineSourceFetch(t *testing.T) {
+	src := NewInlineSource("192.168.0.0/16\n127.0.0.1\n")
+	rc, version, err := src.Fetch(context.Background())
+	assert.Nil(t, err)
+	assert.NotEmpty(t, version)
+
+	data, err := io.ReadAll(rc)
+	assert.Nil(t, err)
+	assert.Nil(t, rc.Close())
+	assert.Equal(t, "192.168.0.0/16\n127.0.0.1\n", string(data))
+
+	// The version is stable for identical data.
+	_, version2, err := src.Fetch(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, version, version2)
+}
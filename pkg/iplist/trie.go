@@ -0,0 +1,168 @@
+package iplist
+
+// trieNode is a node of the compressed binary trie used to store a set of
+// CIDR networks keyed on the raw bits of their network address. bit records
+// the offset (0-indexed from the most significant bit) that this node tests
+// in order to choose between its two children. Runs of bits that every
+// network beneath a node agree on are skipped rather than represented as
+// individual levels, so bit may jump ahead by more than one from a parent
+// to its child. key holds a representative copy of the bits of any network
+// stored beneath this node and is only ever inspected up to bit, which is
+// enough to detect where a newly inserted network diverges from the
+// networks already present.
+type trieNode struct {
+	bit      int
+	key      []byte
+	terminal bool
+	zero     *trieNode
+	one      *trieNode
+}
+
+// trie is a compressed binary radix trie over a fixed-width bit key. A
+// single trie only ever stores keys of one width, so the IPv4 and IPv6
+// address spaces are kept in separate tries.
+type trie struct {
+	root *trieNode
+}
+
+// bitAt returns the bit at the given offset within key, where offset 0 is
+// the most significant bit of key[0].
+func bitAt(key []byte, offset int) byte {
+	return (key[offset/8] >> uint(7-offset%8)) & 1
+}
+
+// diffBit returns the offset of the first bit at which a and b differ,
+// considering only the first limit bits. If no such bit exists, limit is
+// returned.
+func diffBit(a, b []byte, limit int) int {
+	for i := 0; i < limit; i++ {
+		if bitAt(a, i) != bitAt(b, i) {
+			return i
+		}
+	}
+	return limit
+}
+
+// insert adds the network identified by key (its masked address bits) and
+// prefixLen (the number of significant bits) to the trie.
+func (t *trie) insert(key []byte, prefixLen int) {
+	if t.root == nil {
+		t.root = &trieNode{bit: prefixLen, key: key, terminal: true}
+		return
+	}
+
+	cur := t.root
+	var parent *trieNode
+	var wentOne bool
+
+	for {
+		diverge := diffBit(key, cur.key, min(prefixLen, cur.bit))
+
+		if diverge < cur.bit && diverge < prefixLen {
+			// The new network shares a path with cur only up to diverge,
+			// so a new branch node is required above cur.
+			branch := &trieNode{bit: diverge, key: key}
+			leaf := &trieNode{bit: prefixLen, key: key, terminal: true}
+			if bitAt(key, diverge) == 0 {
+				branch.zero, branch.one = leaf, cur
+			} else {
+				branch.zero, branch.one = cur, leaf
+			}
+			t.replace(parent, wentOne, branch)
+			return
+		}
+
+		if prefixLen <= cur.bit {
+			if prefixLen == cur.bit {
+				// Exact match of an existing node's prefix; it may
+				// already have children representing more specific
+				// networks, which is unaffected by marking it terminal.
+				cur.terminal = true
+				return
+			}
+			// The new network ends above cur, so it becomes the parent
+			// of the existing subtree.
+			branch := &trieNode{bit: prefixLen, key: key, terminal: true}
+			if bitAt(cur.key, prefixLen) == 0 {
+				branch.zero = cur
+			} else {
+				branch.one = cur
+			}
+			t.replace(parent, wentOne, branch)
+			return
+		}
+
+		parent = cur
+		if bitAt(key, cur.bit) == 0 {
+			wentOne = false
+			if cur.zero == nil {
+				cur.zero = &trieNode{bit: prefixLen, key: key, terminal: true}
+				return
+			}
+			cur = cur.zero
+		} else {
+			wentOne = true
+			if cur.one == nil {
+				cur.one = &trieNode{bit: prefixLen, key: key, terminal: true}
+				return
+			}
+			cur = cur.one
+		}
+	}
+}
+
+// replace swaps the child of parent that was reached by wentOne for node.
+// A nil parent means node becomes the new root.
+func (t *trie) replace(parent *trieNode, wentOne bool, node *trieNode) {
+	switch {
+	case parent == nil:
+		t.root = node
+	case wentOne:
+		parent.one = node
+	default:
+		parent.zero = node
+	}
+}
+
+// contains walks the trie following the bits of key, one at a time, and
+// returns true as soon as a terminal node is encountered along the path.
+// Since every network stored below a terminal node is necessarily a more
+// specific match, it is never necessary to look any further once one is
+// found. The walk is bounded by the bit width of key, so lookups cost at
+// most 32 steps for IPv4 keys and 128 for IPv6 keys, regardless of how many
+// networks are stored.
+//
+// Because bit skips over runs of bits that every network beneath a node
+// agrees on, reaching a node is not by itself proof that key shares those
+// skipped bits: the walk only ever tests the single bit at n.bit to choose
+// a branch, and never looks at the bits below it. So before trusting a
+// node's terminal flag (or descending past it), key must first be checked
+// against n.key over the full skipped range.
+func (t *trie) contains(key []byte) bool {
+	bits := len(key) * 8
+	n := t.root
+	for n != nil {
+		if diffBit(key, n.key, n.bit) != n.bit {
+			return false
+		}
+		if n.terminal {
+			return true
+		}
+		if n.bit >= bits {
+			return false
+		}
+		if bitAt(key, n.bit) == 0 {
+			n = n.zero
+		} else {
+			n = n.one
+		}
+	}
+	return false
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
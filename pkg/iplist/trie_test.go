@@ -0,0 +1,66 @@
+package iplist
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrieContains(t *testing.T) {
+	var tr trie
+	_, n1, _ := net.ParseCIDR("192.168.0.0/24")
+	_, n2, _ := net.ParseCIDR("10.0.0.0/8")
+
+	ones, _ := n1.Mask.Size()
+	tr.insert(n1.IP.To4(), ones)
+	ones, _ = n2.Mask.Size()
+	tr.insert(n2.IP.To4(), ones)
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"192.168.0.1", true},
+		{"192.168.1.1", false},
+		{"10.1.2.3", true},
+		{"11.0.0.1", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.ip, func(t *testing.T) {
+			assert.Equal(t, test.want, tr.contains(net.ParseIP(test.ip).To4()))
+		})
+	}
+}
+
+func TestTrieContainsOverlappingPrefixes(t *testing.T) {
+	var tr trie
+	_, wide, _ := net.ParseCIDR("172.16.0.0/12")
+	_, narrow, _ := net.ParseCIDR("172.16.5.0/24")
+
+	ones, _ := wide.Mask.Size()
+	tr.insert(wide.IP.To4(), ones)
+	ones, _ = narrow.Mask.Size()
+	tr.insert(narrow.IP.To4(), ones)
+
+	assert.True(t, tr.contains(net.ParseIP("172.16.5.1").To4()))
+	assert.True(t, tr.contains(net.ParseIP("172.31.0.1").To4()))
+	assert.False(t, tr.contains(net.ParseIP("172.32.0.1").To4()))
+}
+
+// TestTrieContainsSingleEntryRejectsUnrelatedAddress guards against a
+// terminal node being trusted without first checking that the query
+// actually shares its stored prefix: with only one /32 ever inserted,
+// that entry becomes the trie's root with no branch above it, so a
+// lookup that short-circuits on n.terminal without comparing bits would
+// match every address rather than just the one inserted.
+func TestTrieContainsSingleEntryRejectsUnrelatedAddress(t *testing.T) {
+	var tr trie
+	_, n, _ := net.ParseCIDR("10.0.0.1/32")
+	ones, _ := n.Mask.Size()
+	tr.insert(n.IP.To4(), ones)
+
+	assert.True(t, tr.contains(net.ParseIP("10.0.0.1").To4()))
+	assert.False(t, tr.contains(net.ParseIP("8.8.8.8").To4()))
+}
@@ -0,0 +1,63 @@
+// Package metrics holds the Prometheus collectors shared across
+// ipfilter's packages, so that a source deep in pkg/iplist and a
+// handler in pkg/api can both contribute to the same exposed metrics
+// without pkg/api having to thread counters down through every call.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// RequestsTotal counts is-bad-ip lookups, partitioned by their result:
+// "bad", "good", or "invalid" for a missing or malformed address.
+var RequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "ipfilter_requests_total",
+	Help: "Total number of is-bad-ip lookups, by result.",
+}, []string{"result"})
+
+// LookupDuration observes how long a single is-bad-ip lookup takes,
+// from the moment the request is received to the moment its response
+// is written.
+var LookupDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "ipfilter_lookup_duration_seconds",
+	Help:    "Duration of is-bad-ip lookups.",
+	Buckets: prometheus.DefBuckets,
+})
+
+// RefreshFailuresTotal counts failed attempts to refresh a List from an
+// individual source, across both the bad address list and the
+// allowlist.
+var RefreshFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "ipfilter_refresh_failures_total",
+	Help: "Total number of failed list refresh attempts.",
+})
+
+// DownloadBytesTotal counts the raw bytes of the archives downloaded by
+// "github-archive" sources, before they are unpacked and parsed, so
+// operators can see the bandwidth cost of a refresh independently of
+// how many addresses it ends up yielding. Bytes read by "http", "file"
+// and "inline" sources are not counted.
+var DownloadBytesTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "ipfilter_download_bytes_total",
+	Help: "Total number of raw bytes downloaded from list sources.",
+})
+
+// ListSize registers a gauge that reports size() whenever /metrics is
+// scraped, rather than needing to be kept in sync by every caller that
+// changes the underlying List.
+func ListSize(size func() float64) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ipfilter_list_size",
+		Help: "Number of CIDRs currently held in the bad ip list.",
+	}, size)
+}
+
+// LastRefreshTimestamp registers a gauge that reports timestamp()
+// whenever /metrics is scraped.
+func LastRefreshTimestamp(timestamp func() float64) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ipfilter_last_refresh_timestamp_seconds",
+		Help: "Unix timestamp of the last attempted list refresh.",
+	}, timestamp)
+}